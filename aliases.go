@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+)
+
+// destAliases returns names of the type aliases declared in the destination
+// package keyed by the qualified name of the aliased type, i.e. "github.com/google/uuid.UUID",
+// only aliases of non-generic named types declared in other packages are taken
+// into account
+func destAliases(prog *loader.Program, destPackagePath string, opts *options) map[string]string {
+	info := prog.Package(destPackagePath)
+	if info == nil {
+		return nil
+	}
+
+	aliases := make(map[string]string)
+
+	scope := info.Pkg.Scope()
+	for _, name := range scope.Names() {
+		obj, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || !obj.IsAlias() {
+			continue
+		}
+
+		//aliases from the test files aren't visible in the non-test output file
+		filename := prog.Fset.Position(obj.Pos()).Filename
+		if strings.HasSuffix(filename, "_test.go") && !strings.HasSuffix(opts.OutputFile, "_test.go") {
+			continue
+		}
+
+		if alias, ok := obj.Type().(*types.Alias); ok && alias.TypeParams().Len() > 0 {
+			continue
+		}
+
+		named, ok := types.Unalias(obj.Type()).(*types.Named)
+		if !ok || named.TypeArgs().Len() > 0 || named.Obj().Pkg() == nil || named.Obj().Pkg() == info.Pkg {
+			continue
+		}
+
+		//names are sorted so the first alias wins when there are several of them
+		key := named.Obj().Pkg().Path() + "." + named.Obj().Name()
+		if _, ok := aliases[key]; !ok {
+			aliases[key] = name
+		}
+	}
+
+	return aliases
+}
+
+// preferDestAliases replaces qualified references to the types that have an
+// alias in the destination package with the alias and drops imports that
+// are not used anymore
+func preferDestAliases(prog *loader.Program, src []byte, aliases map[string]string) ([]byte, error) {
+	if len(aliases) == 0 {
+		return src, nil
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := importedNames(prog, file)
+	if err != nil {
+		return nil, err
+	}
+
+	replaced := false
+	astutil.Apply(file, func(c *astutil.Cursor) bool {
+		sel, ok := c.Node().(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		id, ok := sel.X.(*ast.Ident)
+		if !ok || paths[id.Name] == "" {
+			return true
+		}
+
+		if alias, ok := aliases[paths[id.Name]+"."+sel.Sel.Name]; ok {
+			c.Replace(ast.NewIdent(alias))
+			replaced = true
+		}
+
+		return false
+	}, nil)
+
+	if !replaced {
+		return src, nil
+	}
+
+	if err := removeUnusedImports(prog, fset, file); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// importedNames returns import paths of the file keyed by the names the packages are referred by
+func importedNames(prog *loader.Program, file *ast.File) (map[string]string, error) {
+	paths := make(map[string]string)
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		name := importName(prog, path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		paths[name] = path
+	}
+
+	return paths, nil
+}
+
+// removeUnusedImports removes imports of the packages that are not referred in the file,
+// blank and dot imports are kept
+func removeUnusedImports(prog *loader.Program, fset *token.FileSet, file *ast.File) error {
+	used := make(map[string]bool)
+	ast.Inspect(file, func(node ast.Node) bool {
+		if sel, ok := node.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+
+	for _, spec := range append([]*ast.ImportSpec(nil), file.Imports...) {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return err
+		}
+
+		name, alias := importName(prog, path), ""
+		if spec.Name != nil {
+			name, alias = spec.Name.Name, spec.Name.Name
+		}
+
+		if name != "_" && name != "." && !used[name] {
+			astutil.DeleteNamedImport(fset, file, alias, path)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"go/ast"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// supported values of the -doc-style flag
+const (
+	docStyleAsIs      = "asis"
+	docStyleStripName = "strip-name"
+	docStyleRewrite   = "rewrite"
+)
+
+// methodComments returns comment lines of the method doc to carry over to the interface
+func methodComments(name string, doc *ast.CommentGroup, opts *options) []string {
+	if doc == nil {
+		return nil
+	}
+
+	lines := make([]string, len(doc.List))
+	removed := make([]bool, len(doc.List))
+	for i, c := range doc.List {
+		lines[i] = c.Text
+
+		//directives are meant for typeface and are noise in the interface
+		if strings.HasPrefix(c.Text, directivePrefix) && !opts.KeepDirectives {
+			removed[i] = true
+			continue
+		}
+
+		if opts.DocFilter != nil {
+			lines[i] = filterComment(c.Text, opts.DocFilter)
+			removed[i] = lines[i] == ""
+		}
+	}
+
+	comments := dropSeparators(lines, removed)
+	comments = trimBlankComments(comments)
+
+	//the first line of prose is the only one that mentions the method name by convention
+	for i, c := range comments {
+		if strings.HasPrefix(c, "/*") || strings.HasPrefix(c, directivePrefix) {
+			continue
+		}
+
+		comments[i] = applyDocStyle(name, c, opts.DocStyle)
+		break
+	}
+
+	return comments
+}
+
+// applyDocStyle returns the first line of the method doc formatted according to the style
+func applyDocStyle(name, comment, style string) string {
+	text := strings.TrimPrefix(comment, "//")
+	prefix := comment[:len(comment)-len(strings.TrimLeft(text, " \t"))]
+	text = strings.TrimLeft(text, " \t")
+
+	startsWithName := strings.HasPrefix(text, name+" ")
+	rest := strings.TrimPrefix(text, name+" ")
+
+	switch {
+	case style == docStyleStripName && startsWithName && strings.TrimSpace(rest) != "":
+		return prefix + upperFirst(rest)
+	case style == docStyleRewrite && !startsWithName && text != "" && !strings.HasPrefix(text, "Deprecated:"):
+		return prefix + name + " " + lowerFirst(text)
+	}
+
+	return comment
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// lowerFirst lowercases the first letter unless the first word is an acronym like HTTP
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if next, _ := utf8.DecodeRuneInString(s[size:]); unicode.IsUpper(next) {
+		return s
+	}
+
+	return string(unicode.ToLower(r)) + s[size:]
+}
+
+// filterComment removes lines matching the regular expression from the comment,
+// it returns an empty string if the whole comment should be removed
+func filterComment(comment string, re *regexp.Regexp) string {
+	if strings.HasPrefix(comment, "//") {
+		if re.MatchString(strings.TrimPrefix(comment, "//")) {
+			return ""
+		}
+		return comment
+	}
+
+	lines := strings.Split(comment, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.Contains(line, "/*") || strings.Contains(line, "*/") || !re.MatchString(line) {
+			kept = append(kept, line)
+		}
+	}
+
+	return strings.Join(kept, "\n")
+}
+
+// dropSeparators returns the lines that are not removed along with the empty comment
+// lines separating them, an empty line next to the removed lines is only kept when it
+// still separates paragraphs of the line comments
+func dropSeparators(lines []string, removed []bool) []string {
+	kept := make([]string, 0, len(lines))
+	for i, line := range lines {
+		if removed[i] {
+			continue
+		}
+
+		if isBlankComment(line) && ((i > 0 && removed[i-1]) || (i+1 < len(lines) && removed[i+1])) {
+			next := i + 1
+			for next < len(lines) && removed[next] {
+				next++
+			}
+
+			//a paragraph removed along with the empty lines around it leaves the last one
+			if next > i+1 && next < len(lines) && isBlankComment(lines[next]) {
+				continue
+			}
+
+			if len(kept) == 0 || !isLineComment(kept[len(kept)-1]) || next == len(lines) || !isLineComment(lines[next]) {
+				continue
+			}
+		}
+
+		kept = append(kept, line)
+	}
+
+	return kept
+}
+
+func isLineComment(c string) bool {
+	return strings.HasPrefix(c, "//") && !isBlankComment(c)
+}
+
+func isBlankComment(c string) bool {
+	return strings.TrimSpace(strings.TrimPrefix(c, "//")) == ""
+}
+
+// trimBlankComments removes empty comment lines left at the beginning and at the end of the doc
+func trimBlankComments(comments []string) []string {
+	for len(comments) > 0 && isBlankComment(comments[0]) {
+		comments = comments[1:]
+	}
+
+	for len(comments) > 0 && isBlankComment(comments[len(comments)-1]) {
+		comments = comments[:len(comments)-1]
+	}
+
+	return comments
+}
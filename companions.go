@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/loader"
+)
+
+type (
+	//companion is an interface generated for a struct returned by the methods of the source type
+	companion struct {
+		Name     string
+		TypeName string
+		Methods  map[string]methodInfo
+	}
+)
+
+// companionInterfaces returns interfaces for the structs of the source package
+// that the methods return and rewrites the results of the methods to refer to
+// these interfaces. It only descends one level: results of the companion
+// methods are kept as is, so are the results of the source type itself.
+func companionInterfaces(prog *loader.Program, typeName *types.TypeName, methods map[string]methodInfo, destPkg *types.Package, opts *options) ([]companion, error) {
+	replacements := make(map[*types.TypeName]types.Type)
+
+	//struct types that were already considered, including the ones without exported methods
+	visited := map[*types.TypeName]bool{typeName: true}
+
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var companions []companion
+	for _, name := range names {
+		results := methods[name].Method.Results()
+		for i := 0; i < results.Len(); i++ {
+			obj := returnedStruct(results.At(i).Type(), typeName.Pkg())
+			if obj == nil || visited[obj] {
+				continue
+			}
+			visited[obj] = true
+
+			c := companion{Name: companionName(obj.Name(), opts), TypeName: obj.Name(), Methods: methodSet(prog, obj.Type())}
+			for methodName, m := range c.Methods {
+				if refersTo(m.Method, isCgoType) {
+					delete(c.Methods, methodName)
+				}
+			}
+
+			if len(c.Methods) == 0 {
+				continue
+			}
+
+			if c.Name == opts.InterfaceName {
+				return nil, fmt.Errorf("companion interface of %s has the same name as the generated interface: %s", obj.Name(), c.Name)
+			}
+
+			if err := checkCollision(prog, destPkg.Path(), c.Name, opts); err != nil {
+				return nil, err
+			}
+
+			companions = append(companions, c)
+			replacements[obj] = interfaceType(destPkg, c.Name)
+		}
+	}
+
+	for name, m := range methods {
+		m.Method = replaceResults(m.Method, replacements)
+		methods[name] = m
+	}
+
+	return companions, nil
+}
+
+// returnedStruct returns the struct type declared in the package if the
+// type is either this struct or a pointer to it
+func returnedStruct(t types.Type, pkg *types.Package) *types.TypeName {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() != pkg || !named.Obj().Exported() || named.TypeArgs().Len() > 0 {
+		return nil
+	}
+
+	if _, ok := named.Underlying().(*types.Struct); !ok {
+		return nil
+	}
+
+	return named.Obj()
+}
+
+// companionName returns name of the interface generated for the struct, it
+// is affixed the same way as the main interface or gets the Interface suffix
+func companionName(typeName string, opts *options) string {
+	if opts.InterfacePrefix == "" && opts.InterfaceSuffix == "" {
+		return typeName + "Interface"
+	}
+
+	return opts.InterfacePrefix + typeName + opts.InterfaceSuffix
+}
+
+// interfaceType returns a named interface type declared in the destination package
+func interfaceType(destPkg *types.Package, name string) types.Type {
+	obj := types.NewTypeName(token.NoPos, destPkg, name, nil)
+	return types.NewNamed(obj, types.NewInterfaceType(nil, nil).Complete(), nil)
+}
+
+// replaceResults returns the signature with the struct results replaced with the interfaces
+func replaceResults(sig *types.Signature, replacements map[*types.TypeName]types.Type) *types.Signature {
+	results := sig.Results()
+
+	replaced := false
+	vars := make([]*types.Var, results.Len())
+	for i := range vars {
+		r := results.At(i)
+		vars[i] = r
+
+		t := r.Type()
+		if ptr, ok := t.(*types.Pointer); ok {
+			t = ptr.Elem()
+		}
+
+		named, ok := t.(*types.Named)
+		if !ok {
+			continue
+		}
+
+		if iface, ok := replacements[named.Obj()]; ok && named.TypeArgs().Len() == 0 {
+			vars[i] = types.NewParam(r.Pos(), r.Pkg(), r.Name(), iface)
+			replaced = true
+		}
+	}
+
+	if !replaced {
+		return sig
+	}
+
+	return types.NewSignatureType(sig.Recv(), nil, nil, sig.Params(), types.NewTuple(vars...), sig.Variadic())
+}
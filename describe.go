@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+type (
+	//interfaceDescription is a format agnostic description of the generated interface
+	interfaceDescription struct {
+		Name          string              `json:"name"`
+		SourceType    string              `json:"source_type"`
+		SourcePackage string              `json:"source_package"`
+		Methods       []methodDescription `json:"methods"`
+	}
+
+	methodDescription struct {
+		Name      string `json:"name"`
+		Signature string `json:"signature"`
+		Doc       string `json:"doc,omitempty"`
+	}
+)
+
+// describe returns description of the interface, types in signatures are
+// qualified with package names the same way as in the generated Go code
+func describe(opts *options, packagePath, destPackagePath string, methods map[string]methodInfo) interfaceDescription {
+	desc := interfaceDescription{
+		Name:          opts.InterfaceName,
+		SourceType:    opts.SourceTypeName,
+		SourcePackage: packagePath,
+	}
+
+	qualifier := func(p *types.Package) string {
+		if p.Path() == destPackagePath {
+			return ""
+		}
+		return p.Name()
+	}
+
+	for name, m := range methods {
+		var sig bytes.Buffer
+		types.WriteSignature(&sig, m.Method, qualifier)
+
+		md := methodDescription{Name: name, Signature: name + sig.String()}
+
+		//comments are filtered and styled the same way as in the Go output
+		doc := &ast.CommentGroup{}
+		for _, c := range m.Comments {
+			doc.List = append(doc.List, &ast.Comment{Text: c})
+		}
+		md.Doc = strings.TrimSpace(doc.Text())
+
+		desc.Methods = append(desc.Methods, md)
+	}
+
+	sort.Slice(desc.Methods, func(i, j int) bool { return desc.Methods[i].Name < desc.Methods[j].Name })
+
+	return desc
+}
+
+func (d interfaceDescription) json() ([]byte, error) {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(b, '\n'), nil
+}
+
+func (d interfaceDescription) markdown() []byte {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "# %s\n\n", d.Name)
+	fmt.Fprintf(&buf, "%s contains exportable methods signatures of the %s.%s\n", d.Name, d.SourcePackage, d.SourceType)
+
+	for _, m := range d.Methods {
+		fmt.Fprintf(&buf, "\n## %s\n\n```go\n%s\n```\n", m.Name, m.Signature)
+		if m.Doc != "" {
+			fmt.Fprintf(&buf, "\n%s\n", m.Doc)
+		}
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const directivePrefix = "//typeface:"
+
+type (
+	//filter is a boolean expression evaluated against every method of the source type
+	filter interface {
+		match(name string, m methodInfo) bool
+	}
+
+	notFilter struct {
+		f filter
+	}
+
+	andFilter struct {
+		left, right filter
+	}
+
+	orFilter struct {
+		left, right filter
+	}
+
+	//attrFilter checks that the attribute is set (tags and boolean attributes)
+	attrFilter struct {
+		attr string
+	}
+
+	//cmpFilter compares string value of the attribute with the given value
+	cmpFilter struct {
+		attr   string
+		negate bool
+		value  string
+		re     *regexp.Regexp
+	}
+
+	filterParser struct {
+		expr string
+		pos  int
+	}
+)
+
+func (f notFilter) match(name string, m methodInfo) bool {
+	return !f.f.match(name, m)
+}
+
+func (f andFilter) match(name string, m methodInfo) bool {
+	return f.left.match(name, m) && f.right.match(name, m)
+}
+
+func (f orFilter) match(name string, m methodInfo) bool {
+	return f.left.match(name, m) || f.right.match(name, m)
+}
+
+func (f attrFilter) match(name string, m methodInfo) bool {
+	switch f.attr {
+	case "error":
+		return returnsError(m.Method)
+	case "deprecated":
+		if isDeprecated(m.Doc) {
+			return true
+		}
+	}
+
+	_, ok := docTags(m.Doc)[f.attr]
+	return ok
+}
+
+func (f cmpFilter) match(name string, m methodInfo) bool {
+	var value string
+	switch f.attr {
+	case "name":
+		value = name
+	case "recv":
+		value = "value"
+		if m.Pointer {
+			value = "ptr"
+		}
+	default:
+		value = docTags(m.Doc)[f.attr]
+	}
+
+	if f.re != nil {
+		return f.re.MatchString(value) != f.negate
+	}
+
+	return (value == f.value) != f.negate
+}
+
+// parseFilter parses boolean expression like `name=~^Get && !deprecated && group==reader`
+//
+// Supported attributes are: name (method name), recv (receiver kind: ptr or value),
+// error (method returns error as the last result), deprecated (method doc has a
+// "Deprecated:" paragraph) and any tag set in the method doc with the //typeface:<tag> [value] directive.
+// Attributes can be compared with ==, != and matched with =~, !~ and combined with !, &&, || and parentheses.
+// Values containing spaces, parentheses, & or | should be double-quoted, unquoted regular
+// expressions extend up to the next space so they can contain groups, i.e. `name=~^(Get|Put) && error`.
+func parseFilter(expr string) (filter, error) {
+	p := &filterParser{expr: expr}
+
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter expression %q: %v", expr, err)
+	}
+
+	if p.skipSpaces(); p.pos < len(p.expr) {
+		return nil, fmt.Errorf("invalid filter expression %q: unexpected %q at position %d", expr, p.expr[p.pos:], p.pos)
+	}
+
+	return f, nil
+}
+
+func (p *filterParser) parseOr() (filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consume("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orFilter{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consume("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andFilter{left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filter, error) {
+	if p.consume("!") {
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{f: f}, nil
+	}
+
+	if p.consume("(") {
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("missing closing parenthesis at position %d", p.pos)
+		}
+		return f, nil
+	}
+
+	return p.parseAttr()
+}
+
+func (p *filterParser) parseAttr() (filter, error) {
+	p.skipSpaces()
+
+	start := p.pos
+	for p.pos < len(p.expr) && isAttrChar(rune(p.expr[p.pos])) {
+		p.pos++
+	}
+
+	attr := p.expr[start:p.pos]
+	if attr == "" {
+		return nil, fmt.Errorf("attribute name expected at position %d", start)
+	}
+
+	for _, op := range []string{"==", "!=", "=~", "!~"} {
+		if !p.consume(op) {
+			continue
+		}
+
+		value, err := p.parseValue(op[1] == '~')
+		if err != nil {
+			return nil, err
+		}
+
+		f := cmpFilter{attr: attr, negate: op[0] == '!', value: value}
+		if op[1] == '~' {
+			if f.re, err = regexp.Compile(value); err != nil {
+				return nil, err
+			}
+		}
+
+		return f, nil
+	}
+
+	return attrFilter{attr: attr}, nil
+}
+
+// parseValue parses either a double-quoted string or an unquoted value that ends
+// with a space or an operator character, regular expressions only end with a space
+func (p *filterParser) parseValue(isRegexp bool) (string, error) {
+	p.skipSpaces()
+
+	if strings.HasPrefix(p.expr[p.pos:], `"`) {
+		quoted, err := strconv.QuotedPrefix(p.expr[p.pos:])
+		if err != nil {
+			return "", fmt.Errorf("malformed string at position %d", p.pos)
+		}
+		p.pos += len(quoted)
+		return strconv.Unquote(quoted)
+	}
+
+	start := p.pos
+	for p.pos < len(p.expr) && !unicode.IsSpace(rune(p.expr[p.pos])) {
+		if !isRegexp && strings.ContainsRune("()&|", rune(p.expr[p.pos])) {
+			break
+		}
+		p.pos++
+	}
+
+	if start == p.pos {
+		return "", fmt.Errorf("value expected at position %d", start)
+	}
+
+	return p.expr[start:p.pos], nil
+}
+
+func (p *filterParser) consume(token string) bool {
+	p.skipSpaces()
+	if strings.HasPrefix(p.expr[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) skipSpaces() {
+	for p.pos < len(p.expr) && unicode.IsSpace(rune(p.expr[p.pos])) {
+		p.pos++
+	}
+}
+
+func isAttrChar(r rune) bool {
+	return r == '_' || r == '-' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// docTags returns tags set in the comment group with //typeface:<tag> [value] directives
+func docTags(doc *ast.CommentGroup) map[string]string {
+	tags := map[string]string{}
+	if doc == nil {
+		return tags
+	}
+
+	for _, comment := range doc.List {
+		if !strings.HasPrefix(comment.Text, directivePrefix) {
+			continue
+		}
+
+		chunks := strings.Fields(strings.TrimPrefix(comment.Text, directivePrefix))
+		if len(chunks) == 0 {
+			continue
+		}
+
+		tags[chunks[0]] = strings.Join(chunks[1:], " ")
+	}
+
+	return tags
+}
+
+func isDeprecated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+
+	for _, paragraph := range strings.Split(doc.Text(), "\n\n") {
+		if strings.HasPrefix(paragraph, "Deprecated:") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func returnsError(sig *types.Signature) bool {
+	results := sig.Results()
+	if results.Len() == 0 {
+		return false
+	}
+
+	return types.Identical(results.At(results.Len()-1).Type(), types.Universe.Lookup("error").Type())
+}
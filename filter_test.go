@@ -0,0 +1,110 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+	}{
+		{name: "attribute", expr: "error"},
+		{name: "comparison", expr: "group==reader"},
+		{name: "quoted value", expr: `group == "read write"`},
+		{name: "regexp with groups", expr: "name=~^(Get|Put) && error"},
+		{name: "negated regexp", expr: "name!~Set$"},
+		{name: "parentheses", expr: "!(deprecated || recv==ptr) && group!=writer"},
+		{name: "empty", expr: "", wantErr: true},
+		{name: "missing value", expr: "group==", wantErr: true},
+		{name: "unclosed parenthesis", expr: "(error && deprecated", wantErr: true},
+		{name: "trailing operator", expr: "error &&", wantErr: true},
+		{name: "invalid regexp", expr: "name=~^(Get", wantErr: true},
+		{name: "malformed string", expr: `group=="reader`, wantErr: true},
+		{name: "unexpected input", expr: "error deprecated", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseFilter(tt.expr)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseFilter(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	errorResult := types.NewTuple(types.NewParam(token.NoPos, nil, "", types.Universe.Lookup("error").Type()))
+
+	doc := func(lines ...string) *ast.CommentGroup {
+		group := &ast.CommentGroup{}
+		for _, line := range lines {
+			group.List = append(group.List, &ast.Comment{Text: line})
+		}
+		return group
+	}
+
+	methods := map[string]methodInfo{
+		"Get": {
+			Method: types.NewSignatureType(nil, nil, nil, nil, errorResult, false),
+			Doc:    doc("// Get returns the value.", "//typeface:group reader"),
+		},
+		"Put": {
+			Method:  types.NewSignatureType(nil, nil, nil, nil, errorResult, false),
+			Doc:     doc("// Put stores the value.", "//typeface:group writer"),
+			Pointer: true,
+		},
+		"Len": {
+			Method: types.NewSignatureType(nil, nil, nil, nil, nil, false),
+			Doc:    doc("// Len returns the size.", "//", "// Deprecated: use Size.", "//typeface:group read write"),
+		},
+	}
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: "error", want: []string{"Get", "Put"}},
+		{expr: "!error", want: []string{"Len"}},
+		{expr: "deprecated", want: []string{"Len"}},
+		{expr: "group==reader", want: []string{"Get"}},
+		{expr: `group=="read write"`, want: []string{"Len"}},
+		{expr: "group!=writer", want: []string{"Get", "Len"}},
+		{expr: "recv==ptr", want: []string{"Put"}},
+		{expr: "name=~^(Get|Put) && !deprecated", want: []string{"Get", "Put"}},
+		{expr: "name!~^(Get|Put) || group==reader", want: []string{"Get", "Len"}},
+		{expr: "(recv==value && error) || deprecated", want: []string{"Get", "Len"}},
+		{expr: "group", want: []string{"Get", "Len", "Put"}},
+		{expr: "missing", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			f, err := parseFilter(tt.expr)
+			if err != nil {
+				t.Fatalf("parseFilter(%q): %v", tt.expr, err)
+			}
+
+			var got []string
+			for _, name := range []string{"Get", "Len", "Put"} {
+				if f.match(name, methods[name]) {
+					got = append(got, name)
+				}
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("%q matched %v, want %v", tt.expr, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("%q matched %v, want %v", tt.expr, got, tt.want)
+				}
+			}
+		})
+	}
+}
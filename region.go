@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/loader"
+)
+
+const regionEnd = "//endregion"
+
+// applyRegion puts the generated interface between the //region <name> and
+// //endregion markers of the existing destination file keeping the rest of
+// the file intact, a new file gets the whole generated source with the
+// interface wrapped in the markers
+func applyRegion(prog *loader.Program, src []byte, opts *options) ([]byte, error) {
+	start, end, err := interfaceDecl(src, opts.InterfaceName)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := os.ReadFile(opts.OutputFile)
+	if os.IsNotExist(err) {
+		regioned := string(src[:start]) + "//region " + opts.Region + "\n\n" + string(src[start:end]) + "\n\n" + regionEnd + string(src[end:])
+		return format.Source([]byte(regioned))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	bodyStart, bodyEnd, err := findRegion(existing, opts.Region)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", opts.OutputFile, err)
+	}
+
+	//blank lines keep the marker from becoming a part of the interface doc
+	merged := string(existing[:bodyStart]) + "\n" + string(src[start:end]) + "\n\n" + string(existing[bodyEnd:])
+
+	return mergeImports(prog, []byte(merged), src)
+}
+
+// interfaceDecl returns offsets of the interface declaration including its doc comment
+func interfaceDecl(src []byte, name string) (start, end int, err error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, decl := range file.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE || gd.Specs[0].(*ast.TypeSpec).Name.Name != name {
+			continue
+		}
+
+		pos := gd.Pos()
+		if gd.Doc != nil {
+			pos = gd.Doc.Pos()
+		}
+
+		return fset.Position(pos).Offset, fset.Position(gd.End()).Offset, nil
+	}
+
+	return 0, 0, fmt.Errorf("declaration of %s is not found in the generated source", name)
+}
+
+// findRegion returns offsets of the content between the //region <name> line and the
+// first //endregion line following it
+func findRegion(src []byte, name string) (start, end int, err error) {
+	marker := "//region " + name
+
+	offset := 0
+	start = -1
+	for _, line := range strings.SplitAfter(string(src), "\n") {
+		text := strings.TrimSpace(line)
+
+		switch {
+		case start < 0 && text == marker:
+			start = offset + len(line)
+		case start >= 0 && (text == regionEnd || text == regionEnd+" "+name):
+			return start, offset, nil
+		}
+
+		offset += len(line)
+	}
+
+	if start < 0 {
+		return 0, 0, fmt.Errorf("%s marker is not found", marker)
+	}
+
+	return 0, 0, fmt.Errorf("%s marker is not closed with %s", marker, regionEnd)
+}
+
+// mergeImports adds imports of the generated source to the file and removes
+// the ones that are not used anymore
+func mergeImports(prog *loader.Program, src, generated []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	gen, err := parser.ParseFile(fset, "", generated, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, spec := range gen.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		var name string
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		astutil.AddNamedImport(fset, file, name, path)
+	}
+
+	if err := removeUnusedImports(prog, fset, file); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
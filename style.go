@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+)
+
+// blank line policies between the interface methods detected by -match-style
+const (
+	spacingBlank      = "blank"      //methods are separated with blank lines
+	spacingCompact    = "compact"    //methods follow each other without blank lines
+	spacingDocumented = "documented" //only methods with docs are surrounded by blank lines
+)
+
+// detectSpacing returns the blank line policy of the interfaces declared in the file,
+// gofmt takes care of indentation so the blank lines are the only thing to match
+func detectSpacing(filename string) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, nil, parser.ParseComments)
+	if err != nil {
+		return "", err
+	}
+
+	var pairs, separated, documented int
+	ast.Inspect(file, func(node ast.Node) bool {
+		iface, ok := node.(*ast.InterfaceType)
+		if !ok {
+			return true
+		}
+
+		methods := iface.Methods.List
+		for i := 1; i < len(methods); i++ {
+			prev, cur := methods[i-1], methods[i]
+
+			isSeparated := fset.Position(fieldStart(cur)).Line-fset.Position(fieldEnd(prev)).Line > 1
+			if isSeparated {
+				separated++
+			}
+
+			if isSeparated == (prev.Doc != nil || cur.Doc != nil) {
+				documented++
+			}
+			pairs++
+		}
+
+		return true
+	})
+
+	switch {
+	case pairs == 0:
+		return "", fmt.Errorf("%s doesn't declare interfaces with several methods to match the style of", filename)
+	case separated == pairs:
+		return spacingBlank, nil
+	case separated == 0:
+		return spacingCompact, nil
+	case documented == pairs:
+		return spacingDocumented, nil
+	case separated*2 >= pairs:
+		return spacingBlank, nil
+	}
+
+	return spacingCompact, nil
+}
+
+// applySpacing puts blank lines between the methods of the generated interfaces according to the policy
+func applySpacing(src []byte, spacing string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var edits []edit
+	ast.Inspect(file, func(node ast.Node) bool {
+		iface, ok := node.(*ast.InterfaceType)
+		if !ok {
+			return true
+		}
+
+		methods := iface.Methods.List
+		if len(methods) > 0 {
+			//hand-written interfaces don't start with a blank line
+			edits = append(edits, edit{start: fset.Position(iface.Methods.Opening).Offset + 1, end: fset.Position(fieldStart(methods[0])).Offset, text: "\n"})
+		}
+
+		for i := 1; i < len(methods); i++ {
+			prev, cur := methods[i-1], methods[i]
+
+			separator := "\n"
+			if spacing == spacingBlank || (spacing == spacingDocumented && (prev.Doc != nil || cur.Doc != nil)) {
+				separator = "\n\n"
+			}
+
+			//gofmt restores the indentation of the method
+			edits = append(edits, edit{start: fset.Position(fieldEnd(prev)).Offset, end: fset.Position(fieldStart(cur)).Offset, text: separator})
+		}
+
+		return false
+	})
+
+	if len(edits) == 0 {
+		return src, nil
+	}
+
+	return format.Source(applyEdits(src, edits))
+}
+
+// fieldStart returns position of the field including its doc comment
+func fieldStart(field *ast.Field) token.Pos {
+	if field.Doc != nil {
+		return field.Doc.Pos()
+	}
+	return field.Pos()
+}
+
+// fieldEnd returns position of the end of the field including its trailing comment
+func fieldEnd(field *ast.Field) token.Pos {
+	if field.Comment != nil {
+		return field.Comment.End()
+	}
+	return field.End()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"go/build"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// values of GOOS and GOARCH known to the go command, when they are listed
+// in a tag set they select the target instead of being custom build tags
+var (
+	knownOS = map[string]bool{
+		"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true, "hurd": true,
+		"illumos": true, "ios": true, "js": true, "linux": true, "nacl": true, "netbsd": true, "openbsd": true,
+		"plan9": true, "solaris": true, "wasip1": true, "windows": true, "zos": true,
+	}
+
+	knownArch = map[string]bool{
+		"386": true, "amd64": true, "amd64p32": true, "arm": true, "armbe": true, "arm64": true, "arm64be": true,
+		"loong64": true, "mips": true, "mipsle": true, "mips64": true, "mips64le": true, "mips64p32": true,
+		"mips64p32le": true, "ppc": true, "ppc64": true, "ppc64le": true, "riscv": true, "riscv64": true,
+		"s390": true, "s390x": true, "sparc": true, "sparc64": true, "wasm": true,
+	}
+)
+
+// parseTagSet parses comma or space separated list of build tags, i.e. "linux,arm64,netgo"
+func parseTagSet(value string) ([]string, error) {
+	tags := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("empty tag set")
+	}
+
+	for _, tag := range tags {
+		if !isBuildTag(tag) {
+			return nil, fmt.Errorf("invalid build tag %q in tag set %q", tag, value)
+		}
+	}
+
+	return tags, nil
+}
+
+// applyTagSet configures the build context to load files for the tag set
+func applyTagSet(ctxt *build.Context, tags []string) {
+	cgo := false
+	for _, tag := range tags {
+		switch {
+		case knownOS[tag]:
+			ctxt.GOOS = tag
+		case knownArch[tag]:
+			ctxt.GOARCH = tag
+		case tag == "cgo":
+			cgo = true
+		default:
+			ctxt.BuildTags = append(ctxt.BuildTags, tag)
+		}
+	}
+
+	//the same way as the go command cgo is disabled when the
+	//target is not the host unless it is requested explicitly
+	ctxt.CgoEnabled = cgo || (build.Default.CgoEnabled && ctxt.GOOS == build.Default.GOOS && ctxt.GOARCH == build.Default.GOARCH)
+}
+
+// unionTagSets adds to the methods the ones that the source type has when
+// the package is loaded with the rest of the tag sets, methods available
+// with several tag sets should have the same signatures
+func unionTagSets(methods map[string]methodInfo, opts *options, hidden []string, fset *token.FileSet, packagePath string) error {
+	sources := make(map[string]string)
+	for name := range methods {
+		sources[name] = strings.Join(opts.TagSets[0], ",")
+	}
+
+	for _, tags := range opts.TagSets[1:] {
+		tagSet := strings.Join(tags, ",")
+
+		ctxt := hideFiles(hidden)
+		applyTagSet(ctxt, tags)
+
+		cfg := loaderConfig(opts, ctxt, packagePath)
+		cfg.Fset = fset
+
+		prog, err := cfg.Load()
+		if err != nil {
+			return fmt.Errorf("tag set %s: %v", tagSet, err)
+		}
+
+		typeName, err := lookupType(prog, packagePath, opts)
+		if err != nil {
+			return fmt.Errorf("tag set %s: %v", tagSet, err)
+		}
+
+		other, err := collectMethods(prog, typeName, opts)
+		if err != nil {
+			return fmt.Errorf("tag set %s: %v", tagSet, err)
+		}
+
+		for name, m := range other {
+			existing, ok := methods[name]
+			if !ok {
+				methods[name], sources[name] = m, tagSet
+				continue
+			}
+
+			//packages are loaded separately for every tag set so the types are compared by their names
+			if signatureString(existing.Method, nil) != signatureString(m.Method, nil) {
+				qualifier := func(p *types.Package) string { return p.Name() }
+				return fmt.Errorf("method %s has different signatures with tag sets %s and %s: %s and %s",
+					name, sources[name], tagSet, signatureString(existing.Method, qualifier), signatureString(m.Method, qualifier))
+			}
+		}
+	}
+
+	return nil
+}
+
+// signatureString returns the signature without the receiver and parameter names
+func signatureString(sig *types.Signature, qualifier types.Qualifier) string {
+	unnamed := func(tuple *types.Tuple) *types.Tuple {
+		vars := make([]*types.Var, tuple.Len())
+		for i := range vars {
+			vars[i] = types.NewParam(token.NoPos, nil, "", tuple.At(i).Type())
+		}
+		return types.NewTuple(vars...)
+	}
+
+	return types.TypeString(types.NewSignatureType(nil, nil, nil, unnamed(sig.Params()), unnamed(sig.Results()), sig.Variadic()), qualifier)
+}
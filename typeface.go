@@ -1,14 +1,25 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"go/ast"
+	"go/build"
+	"go/build/constraint"
+	"go/format"
 	"go/parser"
+	"go/token"
 	"go/types"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"golang.org/x/tools/go/loader"
 
@@ -17,23 +28,79 @@ import (
 
 type (
 	options struct {
-		InputFile      string
-		OutputFile     string
-		InterfaceName  string
-		SourceTypeName string
-		Package        string
+		InputFile        string
+		InputIsPath      bool
+		OutputFile       string
+		Outputs          []output
+		InterfaceName    string
+		SourceTypeName   string
+		Package          string
+		Filter           filter
+		Banner           string
+		OnlyEmbedded     bool
+		ExcludeEmbedded  bool
+		Diff             bool
+		DropCommon       bool
+		NegateTag        string
+		CPUProfile       string
+		MemProfile       string
+		DocStyle         string
+		InheritTags      bool
+		ExcludeGenerated bool
+		AnnotateRecv     bool
+		WorkDir          string
+		SelfDirective    bool
+		CoverageMarker   string
+		TestPackage      bool
+		MaxLineLength    int
+		PostCmd          string
+		FollowSymlinks   bool
+		DocFilter        *regexp.Regexp
+		CtxName          string
+		PreferAliases    bool
+		TagSets          [][]string
+		Region           string
+		KeepDirectives   bool
+		MatchStyle       string
+		InterfacePrefix  string
+		InterfaceSuffix  string
+		Companions       bool
 	}
 
+	//output is a file to generate in the given format
+	output struct {
+		Format   string
+		Filename string
+		//Target is the file to write, it differs from the Filename
+		//when the Filename is a symlink followed with -follow-symlinks
+		Target string
+	}
+
+	//stringsFlag collects values of the repeated flag
+	stringsFlag []string
+
 	methodInfo struct {
-		Method *types.Signature
-		Doc    *ast.CommentGroup
+		Method   *types.Signature
+		Doc      *ast.CommentGroup
+		Comments []string
+		//Annotation is a trailing comment of the interface method
+		Annotation string
+		Pointer    bool
+		Promoted   bool
+		Pos        token.Pos
+	}
+
+	//templateData is passed to the interface template
+	templateData struct {
+		TypeParams *types.Signature
+		Methods    map[string]methodInfo
+		Companions []companion
 	}
 
+	//visitor collects doc comments of the methods declared in the package
 	visitor struct {
-		gen          *generator.Generator
-		methods      map[string]methodInfo
-		info         *loader.PackageInfo
-		sourceStruct string
+		info *loader.PackageInfo
+		docs map[types.Object]*ast.CommentGroup
 	}
 )
 
@@ -41,37 +108,76 @@ func main() {
 	opts := processFlags()
 	packagePath := opts.InputFile
 
-	if _, err := os.Stat(packagePath); err == nil {
+	if opts.InputIsPath {
+		var err error
 		if packagePath, err = generator.PackageOf(packagePath); err != nil {
 			die(err)
 		}
 	}
 
-	destPackagePath, err := generator.PackageOf(filepath.Dir(opts.OutputFile))
+	//descriptions are qualified relative to the first output when there is no Go output
+	destDir := filepath.Dir(opts.Outputs[0].Filename)
+	if opts.OutputFile != "" {
+		destDir = filepath.Dir(opts.OutputFile)
+	}
+
+	//in the region mode the destination file is mostly hand-written and
+	//is loaded as is, otherwise the previous output is hidden from the loader
+	var hidden []string
+	if opts.Region == "" {
+		hidden = append(hidden, opts.OutputFile)
+	}
+
+	//diff only reads the outputs so it's safe to do it through the symlinks
+	if !opts.Diff {
+		if err := resolveSymlinks(opts); err != nil {
+			die(err)
+		}
+
+		//the loader sees the previous output by both the symlink and the target name
+		for _, out := range opts.Outputs {
+			if out.Format == "go" && opts.Region == "" {
+				hidden = append(hidden, out.Target)
+			}
+		}
+	}
+
+	//directory of a brand new destination package may not exist yet
+	if !opts.Diff {
+		for _, out := range opts.Outputs {
+			if err := os.MkdirAll(filepath.Dir(out.Target), 0755); err != nil {
+				die(err)
+			}
+		}
+	}
+
+	destPackagePath, err := generator.PackageOf(destDir)
 	if err != nil {
 		die(err)
 	}
 
-	cfg := loader.Config{
-		AllowErrors:         true,
-		ParserMode:          parser.ParseComments,
-		TypeCheckFuncBodies: func(string) bool { return false },
-		TypeChecker: types.Config{
-			IgnoreFuncBodies:         true,
-			FakeImportC:              true,
-			DisableUnusedImportCheck: true,
-			Error: func(err error) {},
-		},
+	stopProfiling, err := startProfiling(opts)
+	if err != nil {
+		die(err)
 	}
 
-	cfg.Import(packagePath)
+	//the previous version of the generated file is replaced only after the
+	//new one is ready, until then it is hidden from the loader
+	ctxt := hideFiles(hidden)
 
-	if err := os.Remove(opts.OutputFile); err != nil && !os.IsNotExist(err) {
-		die(err)
+	//the first tag set is loaded along with the destination package,
+	//methods for the rest of them are loaded separately and merged below
+	if len(opts.TagSets) > 0 {
+		applyTagSet(ctxt, opts.TagSets[0])
 	}
 
-	if destPackagePath != packagePath {
-		cfg.Import(destPackagePath)
+	cfg := loaderConfig(opts, ctxt, packagePath)
+
+	//test files of the destination package are loaded only to detect
+	//declarations that collide with the generated interface, a new
+	//package without any files is qualified by its import path only
+	if destPackagePath != packagePath && hasGoFiles(ctxt, destDir) {
+		cfg.ImportWithTests(destPackagePath)
 	}
 
 	prog, err := cfg.Load()
@@ -79,109 +185,1539 @@ func main() {
 		die(err)
 	}
 
+	//generated file that belongs to the external test package of
+	//the directory refers to this package by its _test path
+	if strings.HasSuffix(opts.Package, "_test") && !strings.HasSuffix(destPackagePath, "_test") {
+		destPackagePath += "_test"
+	}
+
+	if err := checkCollision(prog, destPackagePath, opts.InterfaceName, opts); err != nil {
+		die(err)
+	}
+
+	typeName, err := lookupType(prog, packagePath, opts)
+	if err != nil {
+		die(err)
+	}
+
+	//the type can be declared in the external test package
+	importPath, packagePath := packagePath, typeName.Pkg().Path()
+
+	//external test packages can't be imported
+	if strings.HasSuffix(packagePath, "_test") && packagePath != destPackagePath {
+		die(fmt.Errorf("%s is declared in the external test package %s, the interface can only be generated into this package", opts.SourceTypeName, packagePath))
+	}
+
 	gen := generator.New(prog)
 	gen.ImportWithAlias(destPackagePath, "")
 	gen.SetPackageName(opts.Package)
 	gen.SetVar("structName", opts.SourceTypeName)
 	gen.SetVar("interfaceName", opts.InterfaceName)
 	gen.SetVar("packagePath", packagePath)
-	gen.SetHeader(fmt.Sprintf(`DO NOT EDIT!
+	header := fmt.Sprintf(`DO NOT EDIT!
 This code was generated automatically using github.com/hexdigest/typeface
 The original type %q can be found in %s package
 You can generate mock for this interface using github.com/gojuno/minimock:
 
 minimock -i %s.%s -o ./
-`, opts.SourceTypeName, packagePath, destPackagePath, opts.InterfaceName))
+`, opts.SourceTypeName, packagePath, destPackagePath, opts.InterfaceName)
 
-	v := &visitor{
-		gen:          gen,
-		sourceStruct: opts.SourceTypeName,
-		info:         prog.Package(packagePath),
-		methods:      make(map[string]methodInfo),
+	if opts.Banner != "" {
+		header += "\n" + opts.Banner + "\n"
 	}
 
-	pkg := prog.Package(packagePath)
-	if pkg == nil {
-		die(fmt.Errorf("unable to load package: %s", packagePath))
+	gen.SetHeader(header)
+
+	if variants := excludedDeclarations(packagePath, opts.SourceTypeName); len(variants) > 0 && len(opts.TagSets) == 0 {
+		fmt.Fprintf(os.Stderr, "typeface: using %s declared in %s for GOOS=%s GOARCH=%s, declarations in %s are excluded by build constraints\n",
+			opts.SourceTypeName, filepath.Base(prog.Fset.Position(typeName.Pos()).Filename), build.Default.GOOS, build.Default.GOARCH, strings.Join(variants, ", "))
+	}
+
+	methods, err := collectMethods(prog, typeName, opts)
+	if err != nil {
+		die(err)
+	}
+
+	if len(opts.TagSets) > 1 {
+		if err := unionTagSets(methods, opts, hidden, prog.Fset, importPath); err != nil {
+			die(err)
+		}
+	}
+
+	if len(methods) == 0 {
+		die(fmt.Errorf("type %s from %s doesn't have any exported methods", opts.SourceTypeName, packagePath))
+	}
+
+	if opts.Filter != nil {
+		for name, m := range methods {
+			if !opts.Filter.match(name, m) {
+				delete(methods, name)
+			}
+		}
+
+		if len(methods) == 0 {
+			die(fmt.Errorf("none of the %s methods match the filter", opts.SourceTypeName))
+		}
 	}
 
-	for _, file := range prog.Package(packagePath).Files {
-		ast.Walk(v, file)
+	var companions []companion
+	if opts.Companions {
+		destPkg := types.NewPackage(destPackagePath, opts.Package)
+		if info := prog.Package(destPackagePath); info != nil {
+			destPkg = info.Pkg
+		}
+
+		if companions, err = companionInterfaces(prog, typeName, methods, destPkg, opts); err != nil {
+			die(err)
+		}
+	}
+
+	decorateMethods(methods, opts)
+	for _, c := range companions {
+		decorateMethods(c.Methods, opts)
+	}
+
+	typeParams, wrapped := typeParamsSignature(typeName.Type())
+
+	data := templateData{
+		TypeParams: typeParams,
+		Methods:    methods,
+		Companions: companions,
+	}
+
+	if err := gen.ProcessTemplate("", template, data); err != nil {
+		die(err)
 	}
 
-	if len(v.methods) == 0 {
-		die(fmt.Errorf("type %s was not found in %s or doesn't have any exported methods", opts.SourceTypeName, packagePath))
+	var buf bytes.Buffer
+	if err := gen.Write(&buf); err != nil {
+		die(err)
+	}
+
+	if err := stopProfiling(); err != nil {
+		die(err)
 	}
 
-	if err := gen.ProcessTemplate("", template, v.methods); err != nil {
+	src, err := moveTypeParams(buf.Bytes(), wrapped)
+	if err != nil {
 		die(err)
 	}
 
-	if err := gen.WriteToFilename(opts.OutputFile); err != nil {
+	if opts.PreferAliases {
+		if src, err = preferDestAliases(prog, src, destAliases(prog, destPackagePath, opts)); err != nil {
+			die(err)
+		}
+	}
+
+	if src, err = normalizeImports(prog, src, destPackagePath, opts); err != nil {
 		die(err)
 	}
+
+	if opts.MaxLineLength > 0 {
+		if src, err = wrapSignatures(src, opts.MaxLineLength); err != nil {
+			die(err)
+		}
+	}
+
+	if opts.MatchStyle != "" {
+		spacing, err := detectSpacing(opts.MatchStyle)
+		if err != nil {
+			die(err)
+		}
+
+		if src, err = applySpacing(src, spacing); err != nil {
+			die(err)
+		}
+	}
+
+	if opts.SelfDirective && opts.OutputFile != "" {
+		if src, err = insertAfterPackageClause(src, selfDirective(opts)); err != nil {
+			die(err)
+		}
+	}
+
+	var inherited constraint.Expr
+	if opts.InheritTags {
+		if inherited, err = inheritedConstraint(prog, typeName, methods); err != nil {
+			die(err)
+		}
+	}
+
+	//the coverage marker goes after the build constraint so that the
+	//constraint stays the first line of the file
+	var prologue bytes.Buffer
+	if expr := buildConstraint(opts, inherited); expr != nil {
+		prologue.WriteString("//go:build " + expr.String() + "\n\n")
+	}
+
+	if opts.CoverageMarker != "" {
+		prologue.WriteString(opts.CoverageMarker + "\n\n")
+	}
+
+	src = append(prologue.Bytes(), src...)
+
+	if opts.PostCmd != "" {
+		if src, err = postProcess(opts.PostCmd, src); err != nil {
+			die(err)
+		}
+	}
+
+	if opts.Region != "" {
+		if src, err = applyRegion(prog, src, opts); err != nil {
+			die(err)
+		}
+	}
+
+	desc := describe(opts, packagePath, destPackagePath, methods)
+
+	changed := false
+	for _, out := range opts.Outputs {
+		content := src
+		switch out.Format {
+		case "json":
+			if content, err = desc.json(); err != nil {
+				die(err)
+			}
+		case "md":
+			content = desc.markdown()
+		}
+
+		if opts.Diff {
+			c, err := printDiff(out.Filename, content)
+			if err != nil {
+				die(err)
+			}
+			changed = changed || c
+			continue
+		}
+
+		if err := writeFile(out.Target, content); err != nil {
+			die(err)
+		}
+	}
+
+	if changed {
+		os.Exit(1)
+	}
 }
 
-// Visit implements ast.Visitor
-func (v *visitor) Visit(node ast.Node) ast.Visitor {
-	//we're only interested in public methods
-	if ts, ok := node.(*ast.FuncDecl); ok && ts.Recv != nil && ts.Name.Name[0] == strings.ToUpper(ts.Name.Name)[0] {
-		t, err := v.gen.ExpressionType(ts.Recv.List[0].Type)
+// decorateMethods sets comments and annotations of the interface methods
+func decorateMethods(methods map[string]methodInfo, opts *options) {
+	for name, m := range methods {
+		m.Comments = methodComments(name, m.Doc, opts)
+		if opts.CtxName != "" {
+			m.Method = renameContext(m.Method, opts.CtxName)
+		}
+		if opts.AnnotateRecv {
+			m.Annotation = "value"
+			if m.Pointer {
+				m.Annotation = "ptr"
+			}
+		}
+		methods[name] = m
+	}
+}
+
+// loaderConfig returns configuration of the loader that imports the source package
+func loaderConfig(opts *options, ctxt *build.Context, packagePath string) *loader.Config {
+	cfg := &loader.Config{
+		Build:               ctxt,
+		Cwd:                 opts.WorkDir,
+		AllowErrors:         true,
+		ParserMode:          parser.ParseComments,
+		TypeCheckFuncBodies: func(string) bool { return false },
+		TypeChecker: types.Config{
+			IgnoreFuncBodies:         true,
+			FakeImportC:              true,
+			DisableUnusedImportCheck: true,
+			Error: func(err error) {},
+		},
+	}
+
+	if opts.TestPackage {
+		cfg.ImportWithTests(packagePath)
+	} else {
+		cfg.Import(packagePath)
+	}
+
+	return cfg
+}
+
+// lookupType returns the source type declared in the package or
+// in its external test package
+func lookupType(prog *loader.Program, packagePath string, opts *options) (*types.TypeName, error) {
+	pkg := prog.Package(packagePath)
+	if pkg == nil {
+		return nil, fmt.Errorf("unable to load package: %s", packagePath)
+	}
+
+	if typeName, ok := pkg.Pkg.Scope().Lookup(opts.SourceTypeName).(*types.TypeName); ok {
+		return typeName, nil
+	}
+
+	//types declared in the external test package are looked up in the foo_test package
+	if xtest := prog.Package(packagePath + "_test"); opts.TestPackage && xtest != nil {
+		if typeName, ok := xtest.Pkg.Scope().Lookup(opts.SourceTypeName).(*types.TypeName); ok {
+			return typeName, nil
+		}
+	}
+
+	return nil, fmt.Errorf("type %s was not found in %s", opts.SourceTypeName, packagePath)
+}
+
+// collectMethods returns exported methods of the source type that are
+// selected by the embedding, -drop-common and -exclude-generated options
+func collectMethods(prog *loader.Program, typeName *types.TypeName, opts *options) (map[string]methodInfo, error) {
+	methods := methodSet(prog, typeName.Type())
+
+	if !opts.ExcludeEmbedded {
+		if err := checkAmbiguousMethods(typeName); err != nil {
+			return nil, err
+		}
+	}
+
+	//methods promoted from the embedded fields can be either excluded
+	//with -exclude-embedded or selected exclusively with -only-embedded
+	for name, m := range methods {
+		if m.Method.TypeParams().Len() > 0 {
+			return nil, fmt.Errorf("method %s declares its own type parameters, interfaces can't have such methods", name)
+		}
+
+		if (m.Promoted && opts.ExcludeEmbedded) || (!m.Promoted && opts.OnlyEmbedded) || (opts.DropCommon && isCommonMethod(name, m.Method)) {
+			delete(methods, name)
+		}
+
+		if opts.ExcludeGenerated && isGenerated(prog, m.Pos) {
+			delete(methods, name)
+		}
+
+		//types that cgo generates for C.xxx are unexported and can't be referred from other packages
+		if refersTo(m.Method, isCgoType) {
+			fmt.Fprintf(os.Stderr, "typeface: skipping method %s: its signature refers to C types\n", name)
+			delete(methods, name)
+		}
+	}
+
+	return methods, nil
+}
+
+// normalizeImports drops import aliases that aren't needed to resolve name
+// collisions so that the imports look like the hand-written ones, i.e.
+// context "context" or context2 "context" become just "context" when there is
+// no other package or declaration named context in the file or at the
+// package scope of the destination package
+func normalizeImports(prog *loader.Program, src []byte, destPackagePath string, opts *options) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	taken := make(map[string]bool)
+
+	//declarations of the previous output are going to be replaced
+	if info := prog.Package(destPackagePath); info != nil {
+		scope := info.Pkg.Scope()
+		for _, name := range scope.Names() {
+			if !sameFile(prog.Fset.Position(scope.Lookup(name).Pos()).Filename, opts.OutputFile) {
+				taken[name] = true
+			}
+		}
+	}
+
+	for _, decl := range file.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.TYPE {
+			for _, spec := range gd.Specs {
+				taken[spec.(*ast.TypeSpec).Name.Name] = true
+			}
+		}
+	}
+
+	names := make(map[*ast.ImportSpec]string)
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
 		if err != nil {
-			die(fmt.Errorf("failed to get expression for %T %s: %v", ts.Type, ts.Name.Name, err))
+			return nil, err
 		}
-		chunks := strings.Split(t.String(), ".")
-		typeName := chunks[len(chunks)-1]
 
-		if typeName == v.sourceStruct {
-			if method, ok := v.info.ObjectOf(ts.Name).Type().(*types.Signature); ok {
-				v.methods[ts.Name.Name] = methodInfo{
-					Method: method,
-					Doc:    ts.Doc,
-				}
+		names[spec] = importName(prog, path)
+		if spec.Name != nil {
+			taken[spec.Name.Name] = true
+		} else {
+			taken[names[spec]] = true
+		}
+	}
+
+	renamed := make(map[string]string)
+	for _, spec := range file.Imports {
+		if spec.Name == nil || spec.Name.Name == "_" || spec.Name.Name == "." {
+			continue
+		}
+
+		alias, name := spec.Name.Name, names[spec]
+		if alias != name {
+			if taken[name] {
+				continue
 			}
+			taken[name] = true
+			renamed[alias] = name
 		}
 
+		spec.Name = nil
+	}
+
+	if len(renamed) > 0 {
+		ast.Inspect(file, func(node ast.Node) bool {
+			if sel, ok := node.(*ast.SelectorExpr); ok {
+				if id, ok := sel.X.(*ast.Ident); ok && renamed[id.Name] != "" {
+					id.Name = renamed[id.Name]
+				}
+			}
+			return true
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// checkCollision returns an error if the destination package already declares
+// an identifier with the name of the generated interface somewhere except the
+// destination file itself
+func checkCollision(prog *loader.Program, destPackagePath, name string, opts *options) error {
+	//descriptions don't declare anything
+	if opts.OutputFile == "" {
 		return nil
 	}
 
-	return v
+	//test files aren't loaded when the source type is generated into its own package
+	if pos, ok := testDeclaration(filepath.Dir(opts.OutputFile), name, opts); ok {
+		return fmt.Errorf("%s is already declared in %s at %s", name, destPackagePath, pos)
+	}
+
+	info := prog.Package(destPackagePath)
+	if info == nil {
+		return nil
+	}
+
+	obj := info.Pkg.Scope().Lookup(name)
+	if obj == nil {
+		return nil
+	}
+
+	pos := prog.Fset.Position(obj.Pos())
+	if sameFile(pos.Filename, opts.OutputFile) {
+		return nil
+	}
+
+	return fmt.Errorf("%s is already declared in %s at %s", name, destPackagePath, pos)
 }
 
-func (v *visitor) private() {}
+// testDeclaration returns position of the top-level declaration with the name
+// in the test files of the directory that belong to the destination package
+func testDeclaration(dir, name string, opts *options) (token.Position, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return token.Position{}, false
+	}
 
-const template = `
-	//{{$interfaceName}} contains exportable methods signatures of the {{$packagePath}}.{{$structName}}
-	type {{$interfaceName}} interface {
-		{{ range $methodName, $methodInfo := . }}
-		{{if $methodInfo.Doc }}{{range $i, $comment := $methodInfo.Doc.List}}{{$comment.Text}}
-{{end}}{{end}}{{$methodName}}{{ signature $methodInfo.Method }}
-		{{ end }}
-	}`
+	bp, err := build.ImportDir(dir, 0)
+	if bp == nil || (err != nil && len(bp.TestGoFiles)+len(bp.XTestGoFiles) == 0) {
+		return token.Position{}, false
+	}
 
-func processFlags() *options {
-	var (
-		sname  = flag.String("s", "", "source struct type name")
-		name   = flag.String("i", "", "name of the destination interface")
-		input  = flag.String("f", "", "input file or import path of the package that contains struct type declaration")
-		output = flag.String("o", "", "destination file name to place the generated interface")
-		pkg    = flag.String("p", "", "destination package name")
-	)
+	files := bp.TestGoFiles
+	if strings.HasSuffix(opts.Package, "_test") {
+		files = bp.XTestGoFiles
+	}
 
-	flag.Parse()
+	fset := token.NewFileSet()
+	for _, filename := range files {
+		filename = filepath.Join(bp.Dir, filename)
+		if sameFile(filename, opts.OutputFile) {
+			continue
+		}
 
-	if *pkg == "" || *input == "" || *output == "" || *name == "" || *sname == "" || !strings.HasSuffix(*output, ".go") {
-		flag.Usage()
-		os.Exit(1)
+		file, err := parser.ParseFile(fset, filename, nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil && decl.Name.Name == name {
+					return fset.Position(decl.Name.Pos()), true
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						if spec.Name.Name == name {
+							return fset.Position(spec.Name.Pos()), true
+						}
+					case *ast.ValueSpec:
+						for _, id := range spec.Names {
+							if id.Name == name {
+								return fset.Position(id.Pos()), true
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return token.Position{}, false
+}
+
+func sameFile(a, b string) bool {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
 	}
 
-	return &options{
-		InputFile:      *input,
-		OutputFile:     *output,
-		InterfaceName:  *name,
-		Package:        *pkg,
-		SourceTypeName: *sname,
+	fb, err := os.Stat(b)
+	if err != nil {
+		return false
 	}
+
+	return os.SameFile(fa, fb)
+}
+
+// startProfiling starts CPU profiling if requested and returns a function
+// that stops it and writes the memory profile
+func startProfiling(opts *options) (stop func() error, err error) {
+	var cpuFile *os.File
+	if opts.CPUProfile != "" {
+		if cpuFile, err = os.Create(opts.CPUProfile); err != nil {
+			return nil, err
+		}
+
+		if err := pprof.StartCPUProfile(cpuFile); err != nil {
+			cpuFile.Close()
+			return nil, err
+		}
+	}
+
+	return func() error {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			if err := cpuFile.Close(); err != nil {
+				return err
+			}
+		}
+
+		if opts.MemProfile == "" {
+			return nil
+		}
+
+		f, err := os.Create(opts.MemProfile)
+		if err != nil {
+			return err
+		}
+
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			f.Close()
+			return err
+		}
+
+		return f.Close()
+	}, nil
+}
+
+// buildConstraint returns build constraint of the generated file or nil
+// if the file should be compiled unconditionally
+func buildConstraint(opts *options, inherited constraint.Expr) constraint.Expr {
+	if opts.NegateTag == "" {
+		return inherited
+	}
+
+	negated := &constraint.NotExpr{X: &constraint.TagExpr{Tag: opts.NegateTag}}
+	if inherited == nil {
+		return negated
+	}
+
+	return &constraint.AndExpr{X: inherited, Y: negated}
+}
+
+// inheritedConstraint returns build constraint shared by the file that declares
+// the source type and the files that declare its own methods
+func inheritedConstraint(prog *loader.Program, typeName *types.TypeName, methods map[string]methodInfo) (constraint.Expr, error) {
+	positions := []token.Pos{typeName.Pos()}
+	for _, m := range methods {
+		if !m.Promoted {
+			positions = append(positions, m.Pos)
+		}
+	}
+
+	var (
+		inherited constraint.Expr
+		firstFile string
+	)
+
+	for _, pos := range positions {
+		file := astFile(prog, pos)
+		if file == nil {
+			continue
+		}
+
+		expr, err := fileConstraint(file)
+		if err != nil {
+			return nil, err
+		}
+
+		filename := prog.Fset.Position(pos).Filename
+		if firstFile == "" {
+			inherited, firstFile = expr, filename
+			continue
+		}
+
+		if constraintString(expr) != constraintString(inherited) {
+			return nil, fmt.Errorf("build constraints of %s (%s) and %s (%s) don't agree", firstFile, constraintString(inherited), filename, constraintString(expr))
+		}
+	}
+
+	return inherited, nil
+}
+
+// astFile returns the loaded file that contains the given position
+func astFile(prog *loader.Program, pos token.Pos) *ast.File {
+	for _, info := range prog.AllPackages {
+		for _, file := range info.Files {
+			if file.Pos() <= pos && pos <= file.End() {
+				return file
+			}
+		}
+	}
+
+	return nil
+}
+
+// fileConstraint returns build constraint of the file or nil if there is none,
+// legacy // +build lines are only used when there is no //go:build line
+func fileConstraint(file *ast.File) (constraint.Expr, error) {
+	var plusBuild constraint.Expr
+
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+
+		for _, c := range group.List {
+			switch {
+			case constraint.IsGoBuild(c.Text):
+				return constraint.Parse(c.Text)
+			case constraint.IsPlusBuild(c.Text):
+				expr, err := constraint.Parse(c.Text)
+				if err != nil {
+					return nil, err
+				}
+
+				if plusBuild == nil {
+					plusBuild = expr
+				} else {
+					plusBuild = &constraint.AndExpr{X: plusBuild, Y: expr}
+				}
+			}
+		}
+	}
+
+	return plusBuild, nil
+}
+
+// generatedMarker is the canonical comment that marks generated files, see https://golang.org/s/generatedcode
+var generatedMarker = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated reports whether the first line of the file declaring the
+// position is the generated code marker. The file is read from disk since
+// the loaded one can be rewritten by cgo, the position follows //line
+// directives of such files back to the original one.
+func isGenerated(prog *loader.Program, pos token.Pos) bool {
+	filename := prog.Fset.Position(pos).Filename
+	if filename == "" {
+		return false
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, nil, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil || len(file.Comments) == 0 {
+		return false
+	}
+
+	first := file.Comments[0].List[0]
+	return fset.Position(first.Pos()).Line == 1 && generatedMarker.MatchString(first.Text)
+}
+
+func constraintString(expr constraint.Expr) string {
+	if expr == nil {
+		return "none"
+	}
+
+	return expr.String()
+}
+
+// isBuildTag reports whether the tag can be used in a build constraint
+func isBuildTag(tag string) bool {
+	if tag == "" {
+		return false
+	}
+
+	for _, r := range tag {
+		if r != '_' && r != '.' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isCommonMethod reports whether the method implements error or fmt.Stringer
+func isCommonMethod(name string, sig *types.Signature) bool {
+	if name != "Error" && name != "String" {
+		return false
+	}
+
+	return sig.Params().Len() == 0 && sig.Results().Len() == 1 &&
+		types.Identical(sig.Results().At(0).Type(), types.Typ[types.String])
+}
+
+// selfDirective returns the //go:generate directive that reproduces the current run,
+// paths are relative to the directory of the generated file
+func selfDirective(opts *options) string {
+	dir := filepath.Dir(opts.OutputFile)
+	args := []string{"//go:generate", "typeface"}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "o", "format", "workdir", "diff", "cpuprofile", "memprofile":
+			return
+		case "tag-set":
+			for _, tags := range *f.Value.(*stringsFlag) {
+				args = append(args, "-tag-set", quoteArg(tags))
+			}
+			return
+		case "match-style":
+			args = append(args, "-match-style", relativePath(dir, opts.MatchStyle))
+			return
+		case "f":
+			if exists(opts.InputFile) {
+				args = append(args, "-f", relativePath(dir, opts.InputFile))
+				return
+			}
+		}
+
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() && f.Value.String() == "true" {
+			args = append(args, "-"+f.Name)
+			return
+		}
+
+		args = append(args, "-"+f.Name, quoteArg(f.Value.String()))
+	})
+
+	for _, out := range opts.Outputs {
+		if len(opts.Outputs) > 1 || out.Format != "go" {
+			args = append(args, "-format", out.Format)
+		}
+		args = append(args, "-o", relativePath(dir, out.Filename))
+	}
+
+	return strings.Join(args, " ")
+}
+
+// relativePath returns the path relative to the dir or the absolute path when it can't be made relative
+func relativePath(dir, path string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return path
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return absPath
+	}
+
+	rel = filepath.ToSlash(rel)
+	if !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+
+	return quoteArg(rel)
+}
+
+// quoteArg quotes the argument of the go:generate directive when necessary
+func quoteArg(arg string) string {
+	if arg == "" || strings.ContainsAny(arg, " \t\"'`\\") {
+		return strconv.Quote(arg)
+	}
+
+	return arg
+}
+
+// insertAfterPackageClause inserts the line right after the package clause of the source
+func insertAfterPackageClause(src []byte, line string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.PackageClauseOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := fset.Position(file.Name.End()).Offset
+
+	var buf bytes.Buffer
+	buf.Write(src[:offset])
+	buf.WriteString("\n\n" + line)
+	buf.Write(src[offset:])
+
+	return buf.Bytes(), nil
+}
+
+// importName returns the name of the imported package
+func importName(prog *loader.Program, path string) string {
+	if info := prog.Package(path); info != nil {
+		return info.Pkg.Name()
+	}
+
+	return filepath.Base(path)
+}
+
+// postProcess pipes the source through the command, i.e. gofumpt
+func postProcess(command string, src []byte) ([]byte, error) {
+	args := strings.Fields(command)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(src)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("post command %q failed: %v\n%s", command, err, stderr.String())
+	}
+
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("post command %q produced no output", command)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// printDiff prints unified diff between the existing file and the generated
+// source to stdout and reports whether they differ
+func printDiff(filename string, generated []byte) (bool, error) {
+	existing, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if bytes.Equal(existing, generated) {
+		return false, nil
+	}
+
+	tmp, err := os.CreateTemp("", "typeface")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(generated)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, err
+	}
+
+	old := filename
+	if existing == nil {
+		old = os.DevNull
+	}
+
+	cmd := exec.Command("diff", "-u", "-L", filename, "-L", filename+" (generated)", old, tmp.Name())
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	//diff exits with 1 when the files differ
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+			return false, fmt.Errorf("failed to run diff: %v", err)
+		}
+	}
+
+	return true, nil
+}
+
+// methodSet returns exported methods of the given type including the ones
+// promoted from the embedded fields
+func methodSet(prog *loader.Program, t types.Type) map[string]methodInfo {
+	methods := make(map[string]methodInfo)
+	docs := make(map[types.Object]*ast.CommentGroup)
+	visited := make(map[*types.Package]bool)
+
+	//every method of a generic type can name the receiver type parameters
+	//differently, i.e. func (s *S[A, B]), instantiating the type with its own
+	//type parameters makes all the signatures refer to the declared ones
+	if named, ok := t.(*types.Named); ok && named.TypeParams().Len() > 0 && named.TypeArgs().Len() == 0 {
+		targs := make([]types.Type, named.TypeParams().Len())
+		for i := range targs {
+			targs[i] = named.TypeParams().At(i)
+		}
+
+		if inst, err := types.Instantiate(nil, named, targs, false); err == nil {
+			t = inst
+		}
+	}
+
+	mset := types.NewMethodSet(types.NewPointer(t))
+	for i := 0; i < mset.Len(); i++ {
+		sel := mset.At(i)
+
+		fn, ok := sel.Obj().(*types.Func)
+		if !ok || !fn.Exported() {
+			continue
+		}
+
+		//methods of the embedded types can be declared in other packages
+		if pkg := fn.Pkg(); pkg != nil && !visited[pkg] {
+			visited[pkg] = true
+			if info := prog.Package(pkg.Path()); info != nil {
+				v := &visitor{info: info, docs: docs}
+				for _, file := range info.Files {
+					ast.Walk(v, file)
+				}
+			}
+		}
+
+		sig := fn.Type().(*types.Signature)
+		_, pointer := sig.Recv().Type().(*types.Pointer)
+
+		methods[fn.Name()] = methodInfo{
+			Method:   sig,
+			Doc:      docs[fn.Origin()],
+			Pointer:  pointer,
+			Promoted: len(sel.Index()) > 1,
+			Pos:      fn.Pos(),
+		}
+	}
+
+	return methods
+}
+
+// renameContext returns the signature with the leading context.Context
+// parameter renamed, other unnamed parameters are named _ since Go doesn't
+// allow to mix named and unnamed parameters
+func renameContext(sig *types.Signature, name string) *types.Signature {
+	params := sig.Params()
+	if params.Len() == 0 || !isContext(params.At(0).Type()) || params.At(0).Name() == name {
+		return sig
+	}
+
+	vars := make([]*types.Var, params.Len())
+	for i := range vars {
+		p := params.At(i)
+
+		paramName := p.Name()
+		switch {
+		case i == 0:
+			paramName = name
+		case paramName == name:
+			//renaming would produce duplicate parameter names
+			return sig
+		case paramName == "":
+			paramName = "_"
+		}
+
+		vars[i] = types.NewParam(p.Pos(), p.Pkg(), paramName, p.Type())
+	}
+
+	return types.NewSignatureType(sig.Recv(), nil, nil, types.NewTuple(vars...), sig.Results(), sig.Variadic())
+}
+
+func isContext(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "context" && named.Obj().Name() == "Context"
+}
+
+// checkAmbiguousMethods returns an error if the embedded fields of the struct
+// bring methods with the same name at the same depth, i.e. Set[int] and Set[string],
+// such methods are not part of the method set and would be silently lost
+func checkAmbiguousMethods(typeName *types.TypeName) error {
+	st, ok := typeName.Type().Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+
+	mset := types.NewMethodSet(types.NewPointer(typeName.Type()))
+	qualifier := types.RelativeTo(typeName.Pkg())
+	providers := make(map[string][]string)
+
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if !field.Embedded() {
+			continue
+		}
+
+		t := field.Type()
+		if _, isPtr := t.(*types.Pointer); !isPtr && !types.IsInterface(t) {
+			t = types.NewPointer(t)
+		}
+
+		fieldSet := types.NewMethodSet(t)
+		for j := 0; j < fieldSet.Len(); j++ {
+			fn := fieldSet.At(j).Obj()
+			if !fn.Exported() || mset.Lookup(fn.Pkg(), fn.Name()) != nil {
+				continue
+			}
+
+			provider := field.Name()
+			if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+				recvType := recv.Type()
+				if ptr, ok := recvType.(*types.Pointer); ok {
+					recvType = ptr.Elem()
+				}
+
+				if name := types.TypeString(recvType, qualifier); name != field.Name() {
+					provider = name + " via " + field.Name()
+				}
+			}
+
+			providers[fn.Name()] = append(providers[fn.Name()], provider)
+		}
+	}
+
+	for name, fields := range providers {
+		if len(fields) > 1 {
+			return fmt.Errorf("method %s is promoted to %s from several embedded fields: %s, the interface can't have both", name, typeName.Name(), strings.Join(fields, ", "))
+		}
+	}
+
+	return nil
+}
+
+// refersTo reports whether the type or any of its components is
+// a named type or an alias that satisfies the predicate
+func refersTo(t types.Type, pred func(*types.TypeName) bool) bool {
+	switch t := t.(type) {
+	case *types.Alias:
+		return pred(t.Obj()) || refersTo(types.Unalias(t), pred)
+	case *types.Named:
+		if pred(t.Obj()) {
+			return true
+		}
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			if refersTo(t.TypeArgs().At(i), pred) {
+				return true
+			}
+		}
+	case *types.Pointer:
+		return refersTo(t.Elem(), pred)
+	case *types.Slice:
+		return refersTo(t.Elem(), pred)
+	case *types.Array:
+		return refersTo(t.Elem(), pred)
+	case *types.Chan:
+		return refersTo(t.Elem(), pred)
+	case *types.Map:
+		return refersTo(t.Key(), pred) || refersTo(t.Elem(), pred)
+	case *types.Signature:
+		return refersTo(t.Params(), pred) || refersTo(t.Results(), pred)
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			if refersTo(t.At(i).Type(), pred) {
+				return true
+			}
+		}
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if refersTo(t.Field(i).Type(), pred) {
+				return true
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumMethods(); i++ {
+			if refersTo(t.Method(i).Type(), pred) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isCgoType(t *types.TypeName) bool {
+	return strings.HasPrefix(t.Name(), "_Ctype_")
+}
+
+// Visit implements ast.Visitor
+func (v *visitor) Visit(node ast.Node) ast.Visitor {
+	//we're only interested in public methods
+	if ts, ok := node.(*ast.FuncDecl); ok && ts.Recv != nil && ts.Name.Name[0] == strings.ToUpper(ts.Name.Name)[0] {
+		if obj := v.info.ObjectOf(ts.Name); obj != nil {
+			v.docs[obj] = ts.Doc
+		}
+
+		return nil
+	}
+
+	return v
+}
+
+func (v *visitor) private() {}
+
+const template = `
+	//{{$interfaceName}} contains exportable methods signatures of the {{$packagePath}}.{{$structName}}
+	type {{$interfaceName}} interface {
+		{{if .TypeParams}}` + typeParamsMarker + `{{ signature .TypeParams }}{{end}}
+		{{ template "methods" .Methods -}}
+	}
+	{{ range $companion := .Companions }}
+	//{{$companion.Name}} contains exportable methods signatures of the {{$packagePath}}.{{$companion.TypeName}}
+	type {{$companion.Name}} interface {
+		{{ template "methods" $companion.Methods -}}
+	}
+	{{ end }}
+	{{- define "methods" }}{{ range $methodName, $methodInfo := . }}
+		{{range $i, $comment := $methodInfo.Comments}}{{$comment}}
+{{end}}{{$methodName}}{{ signature $methodInfo.Method }}{{if $methodInfo.Annotation}} // {{$methodInfo.Annotation}}{{end}}
+		{{ end -}}{{ end }}`
+
+func processFlags() *options {
+	var (
+		sname   = flag.String("s", "", "source struct type name")
+		name    = flag.String("i", "", "name of the destination interface")
+		prefix  = flag.String("interface-prefix", "", "prefix of the interface name derived from the source type name when -i is omitted")
+		suffix  = flag.String("interface-suffix", "", "suffix of the interface name derived from the source type name when -i is omitted, i.e. Iface for FooIface")
+		input   = flag.String("f", "", "input file or import path of the package that contains struct type declaration")
+		outputs stringsFlag
+		formats stringsFlag
+		tagSets stringsFlag
+		pkg     = flag.String("p", "", "destination package name")
+		banner  = flag.String("banner", "", "one-line comment to place under the generated header, i.e. 'Regenerate with make gen'")
+		embed   = flag.Bool("only-embedded", false, "only include methods promoted from the embedded fields of the source type")
+		own     = flag.Bool("exclude-embedded", false, "exclude methods promoted from the embedded fields of the source type")
+		diff    = flag.Bool("diff", false, "print the diff between the existing destination file and the generated one instead of writing it, exit with non-zero status when they differ")
+		common  = flag.Bool("drop-common", false, "exclude Error() string and String() string methods")
+		negate  = flag.String("out-build-tag-negate", "", "build tag to negate in the //go:build constraint of the generated file, i.e. to exclude it from the builds with hand-written fallback")
+		inherit = flag.Bool("inherit-build-tags", false, "copy build constraints of the files declaring the source type and its methods to the generated file")
+		skipGen = flag.Bool("exclude-generated", false, "skip methods declared in generated files, i.e. the ones starting with '// Code generated ... DO NOT EDIT.'")
+		recv    = flag.Bool("annotate-receiver", false, "add a trailing comment with the original receiver kind (ptr or value) to every method")
+		workdir = flag.String("workdir", "", "directory to resolve relative -f and -o paths against (default current directory)")
+		self    = flag.Bool("self-directive", false, "add //go:generate directive that reproduces the current run to the generated file")
+		marker  = flag.String("coverage-marker", "", "comment to place at the top of the generated file for the coverage tools, i.e. '//coverage:ignore-file'")
+		tests   = flag.Bool("test-package", false, "look for the source type in test files of the package too, enabled when -f is a _test.go file, the interface can only be used in tests then")
+		maxLen  = flag.Int("max-line-length", 0, "put every parameter of the method on its own line when the method is longer than this (tabs are counted as one character)")
+		postCmd = flag.String("post-cmd", "", "command that gets the generated source on stdin and prints the final source to stdout, i.e. gofumpt")
+		follow  = flag.Bool("follow-symlinks", false, "write through the destination files that are symlinks instead of refusing to replace them")
+		keepDir = flag.Bool("keep-directives", false, "keep //typeface: directive lines of the method docs in the interface")
+		docRe   = flag.String("doc-filter", "", "regular expression, lines of the method docs matching it are not carried over to the interface")
+		refFile = flag.String("match-style", "", "Go file with hand-written interfaces to match the blank lines between the methods with")
+		compan  = flag.Bool("emit-embedded-interface-for-struct-returns", false, "generate interfaces for the structs of the source package returned by the methods and return these interfaces instead, only goes one level deep: methods of the generated companion interfaces return the structs as is. The source type doesn't implement the interface with rewritten results")
+		region  = flag.String("region", "", "name of the //region <name> ... //endregion block of the existing destination file to replace with the interface leaving the rest of the file intact")
+		ctxName = flag.String("ctx-name", "", "name of the leading context.Context parameter of the methods, i.e. ctx")
+		aliases = flag.Bool("prefer-dest-aliases", false, "refer to the types through the aliases declared in the destination package, i.e. ID for uuid.UUID when there is type ID = uuid.UUID")
+		style   = flag.String("doc-style", docStyleAsIs, "how to carry method docs over: asis, strip-name (drop the leading method name) or rewrite (start the doc with the method name)")
+		expr    = flag.String("filter", "", "boolean expression selecting methods to include, i.e. 'name=~^(Get|List) && !deprecated && group==reader', quote values with spaces, parentheses, & or |, unquoted regular expressions end with a space")
+	)
+
+	flag.Var(&outputs, "o", "destination file name to place the generated interface, can be repeated when paired with -format")
+	flag.Var(&tagSets, "tag-set", "comma separated build tags (GOOS and GOARCH values included) to load the source package with, can be repeated to generate the union of the methods available with every tag set, i.e. -tag-set linux -tag-set windows,amd64")
+	flag.Var(&formats, "format", "output format: go, json or md, can be repeated and each -format should be paired with -o (default go)")
+
+	//profiling flags are meant for performance investigations and are not listed in the usage
+	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to the file")
+	memprofile := flag.String("memprofile", "", "write memory profile to the file")
+	hiddenFlags := map[string]bool{"cpuprofile": true, "memprofile": true}
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+
+		visible := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		visible.SetOutput(flag.CommandLine.Output())
+		flag.VisitAll(func(f *flag.Flag) {
+			if !hiddenFlags[f.Name] {
+				visible.Var(f.Value, f.Name, f.Usage)
+				visible.Lookup(f.Name).DefValue = f.DefValue
+			}
+		})
+		visible.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if *pkg == "" || *input == "" || len(outputs) == 0 || (*name == "" && *prefix == "" && *suffix == "") || *sname == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if *name == "" {
+		*name = *prefix + *sname + *suffix
+		if !token.IsIdentifier(*name) {
+			die(fmt.Errorf("interface name %q composed of -interface-prefix, -s and -interface-suffix is not a valid identifier", *name))
+		}
+	}
+
+	opts := &options{
+		InputFile:        *input,
+		InterfaceName:    *name,
+		Package:          *pkg,
+		SourceTypeName:   *sname,
+		Banner:           strings.TrimSpace(*banner),
+		OnlyEmbedded:     *embed,
+		ExcludeEmbedded:  *own,
+		Diff:             *diff,
+		DropCommon:       *common,
+		NegateTag:        *negate,
+		CPUProfile:       *cpuprofile,
+		MemProfile:       *memprofile,
+		DocStyle:         *style,
+		InheritTags:      *inherit,
+		ExcludeGenerated: *skipGen,
+		AnnotateRecv:     *recv,
+		SelfDirective:    *self,
+		CoverageMarker:   strings.TrimSpace(*marker),
+		TestPackage:      *tests || strings.HasSuffix(*input, "_test.go"),
+		MaxLineLength:    *maxLen,
+		PostCmd:          strings.TrimSpace(*postCmd),
+		FollowSymlinks:   *follow,
+		CtxName:          *ctxName,
+		PreferAliases:    *aliases,
+		Region:           strings.TrimSpace(*region),
+		KeepDirectives:   *keepDir,
+		MatchStyle:       *refFile,
+		InterfacePrefix:  *prefix,
+		InterfaceSuffix:  *suffix,
+		Companions:       *compan,
+	}
+
+	if opts.CtxName != "" && !token.IsIdentifier(opts.CtxName) {
+		die(fmt.Errorf("invalid context parameter name: %q", opts.CtxName))
+	}
+
+	if opts.CoverageMarker != "" {
+		if !strings.HasPrefix(opts.CoverageMarker, "//") {
+			opts.CoverageMarker = "//" + opts.CoverageMarker
+		}
+
+		if strings.ContainsAny(opts.CoverageMarker, "\r\n") || constraint.IsGoBuild(opts.CoverageMarker) || constraint.IsPlusBuild(opts.CoverageMarker) {
+			die(fmt.Errorf("coverage marker should be a single line comment that is not a build constraint"))
+		}
+	}
+
+	switch opts.DocStyle {
+	case docStyleAsIs, docStyleStripName, docStyleRewrite:
+	default:
+		die(fmt.Errorf("unknown doc style: %q", opts.DocStyle))
+	}
+
+	opts.InputIsPath = exists(opts.InputFile)
+
+	if *workdir != "" {
+		opts.WorkDir = *workdir
+		//relative paths never fall back to the current directory, an
+		//input that doesn't exist under the workdir is an import path
+		opts.InputIsPath = filepath.IsAbs(opts.InputFile) && exists(opts.InputFile)
+		if candidate := filepath.Join(opts.WorkDir, opts.InputFile); !filepath.IsAbs(opts.InputFile) && (isRelativePath(opts.InputFile) || exists(candidate)) {
+			opts.InputFile, opts.InputIsPath = candidate, true
+		}
+
+		if opts.MatchStyle != "" && !filepath.IsAbs(opts.MatchStyle) {
+			opts.MatchStyle = filepath.Join(opts.WorkDir, opts.MatchStyle)
+		}
+
+		for i, o := range outputs {
+			if !filepath.IsAbs(o) {
+				outputs[i] = filepath.Join(opts.WorkDir, o)
+			}
+		}
+	}
+
+	if len(formats) == 0 {
+		formats = stringsFlag{"go"}
+	}
+
+	if len(formats) != len(outputs) {
+		die(fmt.Errorf("each -format should be paired with -o: got %d formats and %d output files", len(formats), len(outputs)))
+	}
+
+	for i, format := range formats {
+		switch format {
+		case "go":
+			if opts.OutputFile != "" {
+				die(fmt.Errorf("only one output can be in go format"))
+			}
+
+			if !strings.HasSuffix(outputs[i], ".go") {
+				flag.Usage()
+				os.Exit(1)
+			}
+
+			opts.OutputFile = outputs[i]
+		case "json", "md":
+		default:
+			die(fmt.Errorf("unknown output format: %q", format))
+		}
+
+		opts.Outputs = append(opts.Outputs, output{Format: format, Filename: outputs[i], Target: outputs[i]})
+	}
+
+	if opts.OnlyEmbedded && opts.ExcludeEmbedded {
+		die(fmt.Errorf("-only-embedded and -exclude-embedded are mutually exclusive"))
+	}
+
+	for _, value := range tagSets {
+		tags, err := parseTagSet(value)
+		if err != nil {
+			die(err)
+		}
+		opts.TagSets = append(opts.TagSets, tags)
+	}
+
+	if opts.Region != "" && (opts.OutputFile == "" || strings.ContainsAny(opts.Region, "\r\n")) {
+		die(fmt.Errorf("-region should be a single line and requires an output in go format"))
+	}
+
+	//only the interface declaration goes to the region of an existing
+	//file, options affecting the rest of the file would be ignored
+	if opts.Region != "" {
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"emit-embedded-interface-for-struct-returns", opts.Companions},
+			{"self-directive", opts.SelfDirective},
+			{"out-build-tag-negate", opts.NegateTag != ""},
+			{"inherit-build-tags", opts.InheritTags},
+			{"coverage-marker", opts.CoverageMarker != ""},
+			{"banner", opts.Banner != ""},
+		} {
+			if f.set {
+				die(fmt.Errorf("-region can't be used with -%s", f.name))
+			}
+		}
+	}
+
+	if opts.InheritTags && len(opts.TagSets) > 0 {
+		die(fmt.Errorf("-inherit-build-tags can't be used with -tag-set"))
+	}
+
+	if opts.NegateTag != "" && !isBuildTag(opts.NegateTag) {
+		die(fmt.Errorf("invalid build tag: %q", opts.NegateTag))
+	}
+
+	if strings.ContainsAny(opts.Banner, "\r\n") {
+		die(fmt.Errorf("banner should be a single line"))
+	}
+
+	if *docRe != "" {
+		re, err := regexp.Compile(*docRe)
+		if err != nil {
+			die(fmt.Errorf("invalid doc filter: %v", err))
+		}
+		opts.DocFilter = re
+	}
+
+	if *expr != "" {
+		f, err := parseFilter(*expr)
+		if err != nil {
+			die(err)
+		}
+		opts.Filter = f
+	}
+
+	return opts
+}
+
+// String implements flag.Value
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set implements flag.Value
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// excludedDeclarations returns names of the package files that declare the
+// type but are excluded from the current build by the build constraints
+// i.e. foo_darwin.go when generating on linux
+func excludedDeclarations(packagePath, typeName string) []string {
+	bp, err := build.Import(packagePath, "", 0)
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+	for _, name := range bp.IgnoredGoFiles {
+		file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(bp.Dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+
+		for _, decl := range file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+
+			for _, spec := range gd.Specs {
+				if spec.(*ast.TypeSpec).Name.Name == typeName {
+					files = append(files, name)
+				}
+			}
+		}
+	}
+
+	return files
+}
+
+// hideFiles returns a copy of the default build context that doesn't list the files
+func hideFiles(filenames []string) *build.Context {
+	ctxt := build.Default
+
+	hidden := make(map[string][]string)
+	for _, filename := range filenames {
+		if filename != "" {
+			hidden[filepath.Base(filename)] = append(hidden[filepath.Base(filename)], filename)
+		}
+	}
+
+	if len(hidden) == 0 {
+		return &ctxt
+	}
+
+	ctxt.ReadDir = func(dir string) ([]os.FileInfo, error) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		infos := make([]os.FileInfo, 0, len(entries))
+		for _, entry := range entries {
+			if isHidden(filepath.Join(dir, entry.Name()), hidden[entry.Name()]) {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, info)
+		}
+
+		return infos, nil
+	}
+
+	return &ctxt
+}
+
+func isHidden(path string, hidden []string) bool {
+	for _, filename := range hidden {
+		if sameFile(path, filename) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeFile writes the content to a temporary file in the same directory and
+// renames it to the filename so that the file is either replaced completely
+// or left intact if generation is interrupted
+func writeFile(filename string, content []byte) (err error) {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(filename); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(content); err != nil {
+		return err
+	}
+
+	if err = tmp.Chmod(mode); err != nil {
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// resolveSymlinks refuses to replace outputs that are symlinks unless
+// -follow-symlinks is set, in which case outputs are written to the link targets
+func resolveSymlinks(opts *options) error {
+	for i, out := range opts.Outputs {
+		fi, err := os.Lstat(out.Filename)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		target, err := filepath.EvalSymlinks(out.Filename)
+		if err != nil {
+			//dangling symlink, the target is going to be created
+			if target, err = os.Readlink(out.Filename); err != nil {
+				return err
+			}
+
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(out.Filename), target)
+			}
+		}
+
+		if !opts.FollowSymlinks {
+			return fmt.Errorf("%s is a symlink to %s, use -follow-symlinks to write through it", out.Filename, target)
+		}
+
+		opts.Outputs[i].Target = target
+	}
+
+	return nil
+}
+
+// isRelativePath reports whether the argument is explicitly a relative path rather than an import path
+func isRelativePath(arg string) bool {
+	arg = filepath.ToSlash(arg)
+	return arg == "." || arg == ".." || strings.HasPrefix(arg, "./") || strings.HasPrefix(arg, "../") || strings.HasSuffix(arg, ".go")
+}
+
+// hasGoFiles reports whether the directory contains any Go files that match
+// the build context, test files included
+func hasGoFiles(ctxt *build.Context, dir string) bool {
+	_, err := ctxt.ImportDir(dir, 0)
+	return err == nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
 }
 
 func die(err error) {
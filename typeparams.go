@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+)
+
+// typeParamsMarker is a name of the placeholder method that carries type
+// parameters of the interface through the template so that the generator
+// takes care of the qualification and imports of the constraints
+const typeParamsMarker = "typefaceTypeParams"
+
+// typeParamsSignature returns type parameters of the named type as the
+// parameters of a function signature or nil if the type isn't generic,
+// wrapped reports which of the constraints were put into interface{...}
+func typeParamsSignature(t types.Type) (sig *types.Signature, wrapped []bool) {
+	named, ok := t.(*types.Named)
+	if !ok || named.TypeParams().Len() == 0 {
+		return nil, nil
+	}
+
+	vars := make([]*types.Var, 0, named.TypeParams().Len())
+	wrapped = make([]bool, named.TypeParams().Len())
+	for i := 0; i < named.TypeParams().Len(); i++ {
+		tp := named.TypeParams().At(i)
+
+		//implicit constraints like ~int | ~string are only valid in type parameter lists
+		constraint := tp.Constraint()
+		if iface, ok := constraint.(*types.Interface); ok && iface.IsImplicit() {
+			constraint = types.NewInterfaceType(nil, []types.Type{iface.EmbeddedType(0)})
+			wrapped[i] = true
+		}
+
+		vars = append(vars, types.NewVar(token.NoPos, tp.Obj().Pkg(), tp.Obj().Name(), constraint))
+	}
+
+	return types.NewSignatureType(nil, nil, nil, types.NewTuple(vars...), nil, false), wrapped
+}
+
+// moveTypeParams replaces the placeholder method of the interface with
+// its type parameters list, the constraints typeParamsSignature wrapped
+// into interfaces are unwrapped back
+func moveTypeParams(src []byte, wrapped []bool) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	ast.Inspect(file, func(node ast.Node) bool {
+		ts, ok := node.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+
+		iface, ok := ts.Type.(*ast.InterfaceType)
+		if !ok {
+			return false
+		}
+
+		for i, method := range iface.Methods.List {
+			if len(method.Names) == 0 || method.Names[0].Name != typeParamsMarker {
+				continue
+			}
+
+			ts.TypeParams = method.Type.(*ast.FuncType).Params
+
+			index := 0
+			for _, field := range ts.TypeParams.List {
+				//names of the field share the constraint so it is unwrapped only if all of them were wrapped
+				unwrap := len(field.Names) > 0
+				for range field.Names {
+					unwrap = unwrap && index < len(wrapped) && wrapped[index]
+					index++
+				}
+
+				if unwrap {
+					field.Type = simplifyConstraint(field.Type)
+				}
+			}
+
+			iface.Methods.List = append(iface.Methods.List[:i], iface.Methods.List[i+1:]...)
+			found = true
+			break
+		}
+
+		return false
+	})
+
+	if !found {
+		return src, nil
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// simplifyConstraint turns interface{~int | ~string} back into ~int | ~string
+func simplifyConstraint(expr ast.Expr) ast.Expr {
+	iface, ok := expr.(*ast.InterfaceType)
+	if !ok || len(iface.Methods.List) != 1 {
+		return expr
+	}
+
+	return iface.Methods.List[0].Type
+}
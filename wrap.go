@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+	"unicode/utf8"
+)
+
+type (
+	//edit replaces src[start:end] with the text
+	edit struct {
+		start, end int
+		text       string
+	}
+)
+
+// wrapSignatures puts every parameter of the interface method on its own
+// line when the method declaration is longer than maxLen characters,
+// tabs are counted as a single character
+func wrapSignatures(src []byte, maxLen int) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := bytes.Split(src, []byte("\n"))
+
+	var edits []edit
+	ast.Inspect(file, func(node ast.Node) bool {
+		iface, ok := node.(*ast.InterfaceType)
+		if !ok {
+			return true
+		}
+
+		for _, method := range iface.Methods.List {
+			ft, ok := method.Type.(*ast.FuncType)
+			if !ok || ft.Params.NumFields() == 0 {
+				continue
+			}
+
+			opening, closing := fset.Position(ft.Params.Opening), fset.Position(ft.Params.Closing)
+			if opening.Line != closing.Line || utf8.RuneCount(lines[opening.Line-1]) <= maxLen {
+				continue
+			}
+
+			var buf bytes.Buffer
+			buf.WriteString("(\n")
+			for _, param := range ft.Params.List {
+				typ := src[fset.Position(param.Type.Pos()).Offset:fset.Position(param.Type.End()).Offset]
+				if len(param.Names) == 0 {
+					buf.Write(typ)
+					buf.WriteString(",\n")
+				}
+
+				for _, name := range param.Names {
+					buf.WriteString(name.Name + " ")
+					buf.Write(typ)
+					buf.WriteString(",\n")
+				}
+			}
+			buf.WriteString(")")
+
+			edits = append(edits, edit{start: opening.Offset, end: closing.Offset + 1, text: buf.String()})
+		}
+
+		return false
+	})
+
+	if len(edits) == 0 {
+		return src, nil
+	}
+
+	return format.Source(applyEdits(src, edits))
+}
+
+// applyEdits applies non-overlapping edits to the source
+func applyEdits(src []byte, edits []edit) []byte {
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+
+	result := append([]byte(nil), src...)
+	for _, e := range edits {
+		result = append(result[:e.start], append([]byte(e.text), result[e.end:]...)...)
+	}
+
+	return result
+}